@@ -5,6 +5,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"os"
+	"path/filepath"
+	"sync/atomic"
 
 	"github.com/containerd/containerd/v2/core/content"
 	c8dimages "github.com/containerd/containerd/v2/core/images"
@@ -45,46 +48,75 @@ type manifest struct {
 	Config ocispec.Descriptor `json:"config"`
 }
 
-func (i *ImageService) manifestMatchesPlatform(ctx context.Context, img *image.Image, platform ocispec.Platform) (bool, error) {
-	ls, err := i.leases.ListResources(ctx, leases.Lease{ID: imageKey(img.ID().String())})
-	if err != nil {
-		if cerrdefs.IsNotFound(err) {
-			return false, nil
-		}
-		log.G(ctx).WithFields(log.Fields{
-			"error":           err,
-			"image":           img.ID,
-			"desiredPlatform": platforms.FormatAll(platform),
-		}).Error("Error looking up image leases")
-		return false, err
+// makeContentReader bounds a content.ReaderAt to the small manifest/manifest
+// list JSON blobs this package decodes.
+func makeContentReader(ra content.ReaderAt) io.Reader {
+	return io.LimitReader(io.NewSectionReader(ra, 0, ra.Size()), 1e6)
+}
+
+// isManifestMediaType reports whether mt is a media type this package
+// recognizes as a single-platform image manifest, as opposed to a manifest
+// list/index or anything else that might show up in an image's leased
+// content.
+func isManifestMediaType(mt string) bool {
+	switch mt {
+	case ocispec.MediaTypeImageManifest, c8dimages.MediaTypeDockerSchema2Manifest:
+		return true
+	default:
+		return false
 	}
+}
 
-	// Note we are comparing against manifest lists here, which we expect to always have a CPU variant set (where applicable).
-	// So there is no need for the fallback matcher here.
-	comparer := platforms.Only(platform)
+// readManifestConfigDigest reads the content stored at dgst as a
+// single-platform manifest and returns the digest of the image config it
+// references.
+func (i *ImageService) readManifestConfigDigest(ctx context.Context, dgst digest.Digest) (digest.Digest, error) {
+	ra, err := i.content.ReaderAt(ctx, ocispec.Descriptor{Digest: dgst})
+	if err != nil {
+		return "", err
+	}
+	data, err := io.ReadAll(makeContentReader(ra))
+	ra.Close()
+	if err != nil {
+		return "", err
+	}
 
-	var (
-		ml manifestList
-		m  manifest
-	)
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return "", err
+	}
+	return m.Config.Digest, nil
+}
 
-	makeRdr := func(ra content.ReaderAt) io.Reader {
-		return io.LimitReader(io.NewSectionReader(ra, 0, ra.Size()), 1e6)
+// forEachLeasedManifestList walks the content leased for img, decoding each
+// leased resource that parses as a manifest list (or OCI index) and
+// invoking fn with its digest, size, and decoded manifests. Iteration stops
+// as soon as fn returns found=true or a non-nil error, and that error (or
+// the one from listing the leases in the first place) is returned as-is, so
+// callers can still tell a "no leases for this image" not-found apart from
+// a real lookup failure.
+//
+// manifestMatchesPlatform, manifestListDescriptors, and ownManifestDigest
+// all need to find the manifest list(s) referencing the same image ID, so
+// they share this walk instead of each re-implementing it.
+func (i *ImageService) forEachLeasedManifestList(ctx context.Context, img *image.Image, fn func(r leases.Resource, mlDigest digest.Digest, mlSize int64, ml manifestList) (found bool, err error)) error {
+	ls, err := i.leases.ListResources(ctx, leases.Lease{ID: imageKey(img.ID().String())})
+	if err != nil {
+		return err
 	}
 
 	for _, r := range ls {
 		logger := log.G(ctx).WithFields(log.Fields{
-			"image":           img.ID,
-			"desiredPlatform": platforms.FormatAll(platform),
-			"resourceID":      r.ID,
-			"resourceType":    r.Type,
+			"image":        img.ID,
+			"resourceID":   r.ID,
+			"resourceType": r.Type,
 		})
-		logger.Debug("Checking lease resource for platform match")
 		if r.Type != "content" {
 			continue
 		}
 
-		ra, err := i.content.ReaderAt(ctx, ocispec.Descriptor{Digest: digest.Digest(r.ID)})
+		dgst := digest.Digest(r.ID)
+		ra, err := i.content.ReaderAt(ctx, ocispec.Descriptor{Digest: dgst})
 		if err != nil {
 			if cerrdefs.IsNotFound(err) {
 				continue
@@ -93,25 +125,47 @@ func (i *ImageService) manifestMatchesPlatform(ctx context.Context, img *image.I
 			continue
 		}
 
-		data, err := io.ReadAll(makeRdr(ra))
+		data, err := io.ReadAll(makeContentReader(ra))
+		size := ra.Size()
 		ra.Close()
-
 		if err != nil {
 			logger.WithError(err).Error("Error reading manifest list for image")
 			continue
 		}
 
-		ml.Manifests = nil
-
-		if err := json.Unmarshal(data, &ml); err != nil {
-			logger.WithError(err).Error("Error unmarshalling content")
+		var ml manifestList
+		if err := json.Unmarshal(data, &ml); err != nil || len(ml.Manifests) == 0 {
+			if err != nil {
+				logger.WithError(err).Error("Error unmarshalling content")
+			}
 			continue
 		}
 
+		found, err := fn(r, dgst, size, ml)
+		if err != nil || found {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// manifestMatchesPlatform reports whether img has a sibling manifest in the
+// referenced manifest list that matches platform under matcher, returning
+// the descriptor of that manifest so the caller knows which sub-manifest was
+// selected. This makes it possible to do the right thing when an image's own
+// config lies about its platform (the well-known "arm64 manifest pointing at
+// amd64 config" case): the manifest list, not the config, is authoritative.
+func (i *ImageService) manifestMatchesPlatform(ctx context.Context, img *image.Image, platform ocispec.Platform, matcher platforms.Matcher) (bool, ocispec.Descriptor, error) {
+	var matched ocispec.Descriptor
+	err := i.forEachLeasedManifestList(ctx, img, func(r leases.Resource, _ digest.Digest, _ int64, ml manifestList) (bool, error) {
+		logger := log.G(ctx).WithFields(log.Fields{
+			"image":           img.ID,
+			"desiredPlatform": platforms.FormatAll(platform),
+			"resourceID":      r.ID,
+		})
 		for _, md := range ml.Manifests {
-			switch md.MediaType {
-			case ocispec.MediaTypeImageManifest, c8dimages.MediaTypeDockerSchema2Manifest:
-			default:
+			if !isManifestMediaType(md.MediaType) {
 				continue
 			}
 
@@ -120,41 +174,218 @@ func (i *ImageService) manifestMatchesPlatform(ctx context.Context, img *image.I
 				OS:           md.Platform.OS,
 				Variant:      md.Platform.Variant,
 			}
-			if !comparer.Match(p) {
+			if !matcher.Match(p) {
 				logger.WithField("otherPlatform", platforms.FormatAll(p)).Debug("Manifest is not a match")
 				continue
 			}
 
 			// Here we have a platform match for the referenced manifest, let's make sure the manifest is actually for the image config we are using.
-
-			ra, err := i.content.ReaderAt(ctx, ocispec.Descriptor{Digest: md.Digest})
+			cfgDigest, err := i.readManifestConfigDigest(ctx, md.Digest)
 			if err != nil {
-				logger.WithField("otherDigest", md.Digest).WithError(err).Error("Could not get reader for manifest")
+				logger.WithField("otherDigest", md.Digest).WithError(err).Error("Could not read manifest for image")
 				continue
 			}
 
-			data, err := io.ReadAll(makeRdr(ra))
-			ra.Close()
-			if err != nil {
-				logger.WithError(err).Error("Error reading manifest for image")
+			if cfgDigest == img.ID().Digest() {
+				logger.WithField("manifestDigest", md.Digest).Debug("Found matching manifest for image")
+				matched = md
+				return true, nil
+			}
+
+			logger.WithField("otherDigest", md.Digest).Debug("Skipping non-matching manifest")
+		}
+		return false, nil
+	})
+	if err != nil {
+		if cerrdefs.IsNotFound(err) {
+			return false, ocispec.Descriptor{}, nil
+		}
+		log.G(ctx).WithFields(log.Fields{
+			"error":           err,
+			"image":           img.ID,
+			"desiredPlatform": platforms.FormatAll(platform),
+		}).Error("Error looking up image leases")
+		return false, ocispec.Descriptor{}, err
+	}
+
+	return matched.Digest != "", matched, nil
+}
+
+// manifestListDescriptors walks the content leased for img looking for a
+// manifest list (or OCI index) that references it, and returns the
+// descriptor for that manifest list together with the descriptors of the
+// per-platform manifests it contains that are present in the local content
+// store and match one of wanted (all of them, if wanted is empty).
+//
+// It shares the lease-resource walk that manifestMatchesPlatform uses to
+// discover sibling manifests for the same image ID.
+func (i *ImageService) manifestListDescriptors(ctx context.Context, img *image.Image, wanted []ocispec.Platform) (ocispec.Descriptor, []ocispec.Descriptor, error) {
+	comparers := make([]platforms.Matcher, 0, len(wanted))
+	for _, p := range wanted {
+		comparers = append(comparers, platforms.Only(p))
+	}
+	matches := func(p ocispec.Platform) bool {
+		if len(comparers) == 0 {
+			return true
+		}
+		for _, c := range comparers {
+			if c.Match(p) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var (
+		mlDesc            ocispec.Descriptor
+		platformManifests []ocispec.Descriptor
+	)
+	err := i.forEachLeasedManifestList(ctx, img, func(r leases.Resource, dgst digest.Digest, size int64, ml manifestList) (bool, error) {
+		var pm []ocispec.Descriptor
+		for _, md := range ml.Manifests {
+			if !isManifestMediaType(md.MediaType) {
 				continue
 			}
 
-			if err := json.Unmarshal(data, &m); err != nil {
-				logger.WithError(err).Error("Error desserializing manifest")
+			p := ocispec.Platform{
+				Architecture: md.Platform.Architecture,
+				OS:           md.Platform.OS,
+				Variant:      md.Platform.Variant,
+			}
+			if !matches(p) {
 				continue
 			}
+			if _, err := i.content.ReaderAt(ctx, md); err != nil {
+				if cerrdefs.IsNotFound(err) {
+					// Not available locally, so we can't push it.
+					continue
+				}
+				log.G(ctx).WithFields(log.Fields{"image": img.ID, "resourceID": r.ID}).WithField("otherDigest", md.Digest).WithError(err).Error("Could not get reader for manifest")
+				continue
+			}
+			pm = append(pm, md)
+		}
+		if len(pm) == 0 {
+			return false, nil
+		}
 
-			if m.Config.Digest == img.ID().Digest() {
-				logger.WithField("manifestDigest", md.Digest).Debug("Found matching manifest for image")
+		mlDesc = ocispec.Descriptor{
+			Digest:    dgst,
+			MediaType: c8dimages.MediaTypeDockerSchema2ManifestList,
+			Size:      size,
+		}
+		platformManifests = pm
+		return true, nil
+	})
+	if err != nil {
+		return ocispec.Descriptor{}, nil, err
+	}
+	if platformManifests == nil {
+		return ocispec.Descriptor{}, nil, cerrdefs.ErrNotFound
+	}
+
+	return mlDesc, platformManifests, nil
+}
+
+// ownManifestDigest walks the content leased for img and returns the digest
+// of the single-platform manifest whose config matches img's own config, so
+// that callers can look up things (such as attestations) that reference that
+// manifest as their OCI referrers subject.
+func (i *ImageService) ownManifestDigest(ctx context.Context, img *image.Image) (digest.Digest, error) {
+	var found digest.Digest
+	err := i.forEachLeasedManifestList(ctx, img, func(_ leases.Resource, _ digest.Digest, _ int64, ml manifestList) (bool, error) {
+		for _, md := range ml.Manifests {
+			if !isManifestMediaType(md.MediaType) {
+				continue
+			}
+
+			cfgDigest, err := i.readManifestConfigDigest(ctx, md.Digest)
+			if err != nil {
+				continue
+			}
+			if cfgDigest == img.ID().Digest() {
+				found = md.Digest
 				return true, nil
 			}
+		}
+		return false, nil
+	})
+	if err != nil {
+		if cerrdefs.IsNotFound(err) {
+			return "", nil
+		}
+		return "", err
+	}
 
-			logger.WithField("otherDigest", md.Digest).Debug("Skipping non-matching manifest")
+	return found, nil
+}
+
+// referrerManifest is the subset of an OCI manifest needed to recognize it
+// as an attestation manifest (e.g. in-toto provenance or an SBOM) referring
+// back to another manifest via the OCI referrers "subject" field, and (via
+// Layers) to read its predicate payload back out again.
+type referrerManifest struct {
+	ArtifactType string               `json:"artifactType,omitempty"`
+	Subject      *ocispec.Descriptor  `json:"subject,omitempty"`
+	Layers       []ocispec.Descriptor `json:"layers,omitempty"`
+}
+
+// attestationManifestsFor returns the descriptors of any attestation
+// manifests in img's leased content that declare subjectDigest as their OCI
+// referrers subject, so that PushImage can upload them as referrers
+// alongside the image they attest to.
+func (i *ImageService) attestationManifestsFor(ctx context.Context, img *image.Image, subjectDigest digest.Digest) ([]ocispec.Descriptor, error) {
+	if subjectDigest == "" {
+		return nil, nil
+	}
+
+	ls, err := i.leases.ListResources(ctx, leases.Lease{ID: imageKey(img.ID().String())})
+	if err != nil {
+		if cerrdefs.IsNotFound(err) {
+			return nil, nil
 		}
+		return nil, err
 	}
 
-	return false, nil
+	var attestations []ocispec.Descriptor
+	for _, r := range ls {
+		if r.Type != "content" {
+			continue
+		}
+
+		dgst := digest.Digest(r.ID)
+		ra, err := i.content.ReaderAt(ctx, ocispec.Descriptor{Digest: dgst})
+		if err != nil {
+			if cerrdefs.IsNotFound(err) {
+				continue
+			}
+			continue
+		}
+
+		data, err := io.ReadAll(io.LimitReader(io.NewSectionReader(ra, 0, ra.Size()), 1e6))
+		size := ra.Size()
+		ra.Close()
+		if err != nil {
+			continue
+		}
+
+		var rm referrerManifest
+		if err := json.Unmarshal(data, &rm); err != nil || rm.Subject == nil || rm.ArtifactType == "" {
+			continue
+		}
+		if rm.Subject.Digest != subjectDigest {
+			continue
+		}
+
+		attestations = append(attestations, ocispec.Descriptor{
+			Digest:       dgst,
+			MediaType:    ocispec.MediaTypeImageManifest,
+			ArtifactType: rm.ArtifactType,
+			Size:         size,
+		})
+	}
+
+	return attestations, nil
 }
 
 // GetImage returns an image corresponding to the image referred to by refOrID.
@@ -170,16 +401,27 @@ func (i *ImageService) GetImage(ctx context.Context, refOrID string, options bac
 			Variant:      retImg.Variant,
 		}
 		p := *options.Platform
-		// Note that `platforms.Only` will fuzzy match this for us
-		// For example: an armv6 image will run just fine on an armv7 CPU, without emulation or anything.
-		if OnlyPlatformWithFallback(p).Match(imgPlat) {
+		// Note that the configured PlatformMatcherPolicy may fuzzy match this for us.
+		// For example: with the default VariantFallbackPolicy, an armv6 image will
+		// run just fine on an armv7 CPU, without emulation or anything.
+		matcher := currentPlatformMatcherPolicy().Matcher(p)
+		if matcher.Match(imgPlat) {
 			return
 		}
 		// In some cases the image config can actually be wrong (e.g. classic `docker build` may not handle `--platform` correctly)
 		// So we'll look up the manifest list that corresponds to this image to check if at least the manifest list says it is the correct image.
-		var matches bool
-		matches, retErr = i.manifestMatchesPlatform(ctx, retImg, p)
+		var (
+			matches     bool
+			matchedDesc ocispec.Descriptor
+		)
+		matches, matchedDesc, retErr = i.manifestMatchesPlatform(ctx, retImg, p, matcher)
 		if matches || retErr != nil {
+			if matches {
+				log.G(ctx).WithFields(log.Fields{
+					"image":           retImg.ID,
+					"matchedManifest": matchedDesc.Digest,
+				}).Debug("Image config platform didn't match, but a manifest in its manifest list did")
+			}
 			return
 		}
 
@@ -197,6 +439,11 @@ func (i *ImageService) GetImage(ctx context.Context, refOrID string, options bac
 		}
 		retErr = errdefs.NotFound(errors.Errorf("image with reference %s was found but its platform (%s) does not match the specified platform (%s)", imgName, platforms.FormatAll(imgPlat), platforms.FormatAll(p)))
 	}()
+	refOrID, err := i.ResolveShortName(refOrID)
+	if err != nil {
+		return nil, errdefs.InvalidParameter(err)
+	}
+
 	ref, err := reference.ParseAnyReference(refOrID)
 	if err != nil {
 		return nil, errdefs.InvalidParameter(err)
@@ -262,3 +509,139 @@ func (m *onlyFallbackMatcher) Match(other ocispec.Platform) bool {
 	otherN := platforms.Normalize(other)
 	return m.p.OS == otherN.OS && m.p.Architecture == otherN.Architecture
 }
+
+// PlatformMatcherPolicy produces the platforms.Matcher that GetImage uses to
+// decide whether a locally-stored image satisfies a requested platform, and
+// that manifestMatchesPlatform uses when falling back to the image's
+// manifest list. Implementations trade off strictness for convenience; see
+// StrictOnlyPolicy, VariantFallbackPolicy, ArchFallbackPolicy, and
+// EmulatedPolicy.
+type PlatformMatcherPolicy interface {
+	// Matcher returns the platforms.Matcher to compare a candidate platform
+	// against the requested platform p.
+	Matcher(p ocispec.Platform) platforms.Matcher
+}
+
+// platformMatcherPolicy is the policy ImageService.GetImage currently uses.
+// It is configured once via SetPlatformMatcherPolicy, typically from daemon
+// startup, and defaults to VariantFallbackPolicy to preserve Docker's
+// traditional behavior. It's stored behind an atomic.Pointer rather than
+// read and written directly, since SetPlatformMatcherPolicy and GetImage can
+// run concurrently once the daemon has started.
+var platformMatcherPolicy atomic.Pointer[PlatformMatcherPolicy]
+
+func init() {
+	var p PlatformMatcherPolicy = VariantFallbackPolicy{}
+	platformMatcherPolicy.Store(&p)
+}
+
+// SetPlatformMatcherPolicy configures the PlatformMatcherPolicy GetImage uses
+// for the remainder of the daemon's lifetime.
+func SetPlatformMatcherPolicy(policy PlatformMatcherPolicy) {
+	platformMatcherPolicy.Store(&policy)
+}
+
+// currentPlatformMatcherPolicy returns the PlatformMatcherPolicy GetImage
+// should use for this call.
+func currentPlatformMatcherPolicy() PlatformMatcherPolicy {
+	return *platformMatcherPolicy.Load()
+}
+
+// StrictOnlyPolicy requires an exact platforms.Only match, with no fallback
+// of any kind. Use this when running an image built for the wrong platform
+// must always be treated as an error.
+type StrictOnlyPolicy struct{}
+
+// Matcher implements PlatformMatcherPolicy.
+func (StrictOnlyPolicy) Matcher(p ocispec.Platform) platforms.Matcher {
+	return platforms.Only(p)
+}
+
+// VariantFallbackPolicy is the default policy: it matches exactly, except
+// that a candidate platform with no CPU variant set is still considered a
+// match (see OnlyPlatformWithFallback for why).
+type VariantFallbackPolicy struct{}
+
+// Matcher implements PlatformMatcherPolicy.
+func (VariantFallbackPolicy) Matcher(p ocispec.Platform) platforms.Matcher {
+	return OnlyPlatformWithFallback(p)
+}
+
+// archFallbacks pairs architectures that a host can typically run without
+// emulation: amd64 CPUs natively run 386 code, and most arm64 kernels are
+// configured to run 32-bit arm (aarch32) binaries.
+var archFallbacks = map[string]string{
+	"amd64": "386",
+	"arm64": "arm",
+}
+
+// ArchFallbackPolicy extends VariantFallbackPolicy by also allowing the
+// architecture pairs in archFallbacks, regardless of CPU variant.
+type ArchFallbackPolicy struct{}
+
+// Matcher implements PlatformMatcherPolicy.
+func (ArchFallbackPolicy) Matcher(p ocispec.Platform) platforms.Matcher {
+	return &archFallbackMatcher{fallback: VariantFallbackPolicy{}.Matcher(p), p: p}
+}
+
+type archFallbackMatcher struct {
+	fallback platforms.Matcher
+	p        ocispec.Platform
+}
+
+func (m *archFallbackMatcher) Match(other ocispec.Platform) bool {
+	if m.fallback.Match(other) {
+		return true
+	}
+	return other.OS == m.p.OS && archFallbacks[m.p.Architecture] == other.Architecture
+}
+
+// binfmtMiscHandlers maps an architecture to the name under which
+// qemu-user-static conventionally registers its binfmt_misc handler for it.
+var binfmtMiscHandlers = map[string]string{
+	"386":      "qemu-i386",
+	"amd64":    "qemu-x86_64",
+	"arm":      "qemu-arm",
+	"arm64":    "qemu-aarch64",
+	"mips64le": "qemu-mips64el",
+	"ppc64le":  "qemu-ppc64le",
+	"riscv64":  "qemu-riscv64",
+	"s390x":    "qemu-s390x",
+}
+
+// EmulatedPolicy extends VariantFallbackPolicy by also allowing any platform
+// for which a binfmt_misc handler is registered on the host, detected by
+// probing /proc/sys/fs/binfmt_misc. This lets the daemon run images for
+// architectures the host has no native support for, as long as qemu-user or
+// an equivalent interpreter has been registered (e.g. by
+// tonistiigi/binfmt or the qemu-user-static package).
+type EmulatedPolicy struct{}
+
+// Matcher implements PlatformMatcherPolicy.
+func (EmulatedPolicy) Matcher(p ocispec.Platform) platforms.Matcher {
+	return &emulatedMatcher{fallback: VariantFallbackPolicy{}.Matcher(p), p: p}
+}
+
+type emulatedMatcher struct {
+	fallback platforms.Matcher
+	p        ocispec.Platform
+}
+
+func (m *emulatedMatcher) Match(other ocispec.Platform) bool {
+	if m.fallback.Match(other) {
+		return true
+	}
+	if other.OS != m.p.OS {
+		return false
+	}
+	return binfmtHandlerRegistered(other.Architecture)
+}
+
+func binfmtHandlerRegistered(arch string) bool {
+	name, ok := binfmtMiscHandlers[arch]
+	if !ok {
+		return false
+	}
+	_, err := os.Stat(filepath.Join("/proc/sys/fs/binfmt_misc", name))
+	return err == nil
+}
@@ -0,0 +1,91 @@
+package images
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+
+	"github.com/moby/moby/api/types/backend"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// Attestation pairs an attestation manifest's descriptor with its raw
+// predicate payload (e.g. an in-toto SLSA provenance statement or an SBOM),
+// as found by ImageAttestations.
+type Attestation struct {
+	Descriptor ocispec.Descriptor
+	Predicate  json.RawMessage
+}
+
+// ImageAttestations returns the attestation manifests that refer to the
+// single-platform manifest for refOrID as their OCI referrers subject,
+// together with each attestation's raw predicate payload. This is the
+// pull-side counterpart to the attestations PushImage uploads via
+// attestationManifestsFor.
+//
+// It returns the predicate as raw JSON rather than a decoded
+// solver/llbsolver/provenance/types predicate: that buildkit package isn't
+// vendored into this tree, so there is nothing to decode the SLSA
+// provenance statement into. Callers that have that package available can
+// unmarshal Attestation.Predicate into it themselves.
+func (i *ImageService) ImageAttestations(ctx context.Context, refOrID string) ([]Attestation, error) {
+	img, err := i.GetImage(ctx, refOrID, backend.GetImageOpts{})
+	if err != nil {
+		return nil, err
+	}
+
+	subjectDigest, err := i.ownManifestDigest(ctx, img)
+	if err != nil {
+		return nil, err
+	}
+
+	descs, err := i.attestationManifestsFor(ctx, img, subjectDigest)
+	if err != nil {
+		return nil, err
+	}
+
+	attestations := make([]Attestation, 0, len(descs))
+	for _, d := range descs {
+		predicate, err := i.attestationPredicate(ctx, d)
+		if err != nil {
+			return nil, err
+		}
+		attestations = append(attestations, Attestation{Descriptor: d, Predicate: predicate})
+	}
+	return attestations, nil
+}
+
+// attestationPredicate reads the attestation manifest at attestationDesc and
+// returns the raw bytes of its predicate layer, the first (and for in-toto
+// attestations, only) layer of the manifest.
+func (i *ImageService) attestationPredicate(ctx context.Context, attestationDesc ocispec.Descriptor) (json.RawMessage, error) {
+	ra, err := i.content.ReaderAt(ctx, attestationDesc)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(makeContentReader(ra))
+	ra.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	var rm referrerManifest
+	if err := json.Unmarshal(data, &rm); err != nil {
+		return nil, err
+	}
+	if len(rm.Layers) == 0 {
+		return nil, nil
+	}
+
+	layerRa, err := i.content.ReaderAt(ctx, rm.Layers[0])
+	if err != nil {
+		return nil, err
+	}
+	defer layerRa.Close()
+
+	payload, err := io.ReadAll(io.NewSectionReader(layerRa, 0, layerRa.Size()))
+	if err != nil {
+		return nil, err
+	}
+	return json.RawMessage(payload), nil
+}
@@ -16,11 +16,79 @@ import (
 	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
+// PushOptions holds the parameters to PushImage.
+//
+// AllPlatforms and Platforms are only set by callers of PushImage itself:
+// nothing in this tree maps the client's image.PushOptions (as passed to
+// Client.ImagePush, e.g. by testutil/daemon/registry.go's Push) onto them,
+// so a push made through the client pushes a single image.
+type PushOptions struct {
+	// Platform restricts the push to the single image matching this platform.
+	// It is mutually exclusive with AllPlatforms.
+	Platform *ocispec.Platform
+
+	// AllPlatforms, if true, pushes the manifest list (or OCI index) for ref
+	// along with every per-platform manifest it references that is available
+	// in the local content store, instead of a single platform-specific image.
+	AllPlatforms bool
+
+	// Platforms restricts which of the manifest list's platforms are pushed
+	// when AllPlatforms is set. A nil or empty slice pushes all of them.
+	Platforms []ocispec.Platform
+}
+
 // PushImage initiates a push operation on the repository named localName.
-func (i *ImageService) PushImage(ctx context.Context, ref reference.Named, platform *ocispec.Platform, metaHeaders map[string][]string, authConfig *registry.AuthConfig, outStream io.Writer) error {
-	if platform != nil {
+func (i *ImageService) PushImage(ctx context.Context, ref reference.Named, opts PushOptions, metaHeaders map[string][]string, authConfig *registry.AuthConfig, outStream io.Writer) error {
+	var (
+		manifestListDesc  ocispec.Descriptor
+		platformManifests []ocispec.Descriptor
+	)
+	switch {
+	case opts.AllPlatforms:
+		img, err := i.GetImage(ctx, ref.String(), backend.GetImageOpts{})
+		if err != nil {
+			return err
+		}
+		manifestListDesc, platformManifests, err = i.manifestListDescriptors(ctx, img, opts.Platforms)
+		if err != nil {
+			return err
+		}
+		wanted := platformManifests
+		for _, md := range wanted {
+			attestations, err := i.attestationManifestsFor(ctx, img, md.Digest)
+			if err != nil {
+				return err
+			}
+			platformManifests = append(platformManifests, attestations...)
+		}
+	case opts.Platform != nil:
 		// Check if the image is actually the platform we want to push.
-		_, err := i.GetImage(ctx, ref.String(), backend.GetImageOpts{Platform: platform})
+		img, err := i.GetImage(ctx, ref.String(), backend.GetImageOpts{Platform: opts.Platform})
+		if err != nil {
+			return err
+		}
+		subjectDigest, err := i.ownManifestDigest(ctx, img)
+		if err != nil {
+			return err
+		}
+		platformManifests, err = i.attestationManifestsFor(ctx, img, subjectDigest)
+		if err != nil {
+			return err
+		}
+	default:
+		// Neither AllPlatforms nor Platform was given: still look the image
+		// up through GetImage, so that attestations referring to it are
+		// found and pushed along with it on this, the most common push
+		// path. ref itself is pushed as given.
+		img, err := i.GetImage(ctx, ref.String(), backend.GetImageOpts{})
+		if err != nil {
+			return err
+		}
+		subjectDigest, err := i.ownManifestDigest(ctx, img)
+		if err != nil {
+			return err
+		}
+		platformManifests, err = i.attestationManifestsFor(ctx, img, subjectDigest)
 		if err != nil {
 			return err
 		}
@@ -50,9 +118,11 @@ func (i *ImageService) PushImage(ctx context.Context, ref reference.Named, platf
 			ImageStore:       distribution.NewImageConfigStoreFromStore(i.imageStore),
 			ReferenceStore:   i.referenceStore,
 		},
-		ConfigMediaType: schema2.MediaTypeImageConfig,
-		LayerStores:     distribution.NewLayerProvidersFromStore(i.layerStore),
-		UploadManager:   i.uploadManager,
+		ConfigMediaType:        schema2.MediaTypeImageConfig,
+		LayerStores:            distribution.NewLayerProvidersFromStore(i.layerStore),
+		UploadManager:          i.uploadManager,
+		ManifestListDescriptor: manifestListDesc,
+		AssociatedManifests:    platformManifests,
 	}
 
 	err := distribution.Push(ctx, ref, imagePushConfig)
@@ -0,0 +1,37 @@
+package images
+
+import (
+	"testing"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"gotest.tools/v3/assert"
+)
+
+func TestIsManifestMediaType(t *testing.T) {
+	assert.Assert(t, isManifestMediaType(ocispec.MediaTypeImageManifest))
+	assert.Assert(t, isManifestMediaType("application/vnd.docker.distribution.manifest.v2+json"))
+	assert.Assert(t, !isManifestMediaType(ocispec.MediaTypeImageIndex))
+	assert.Assert(t, !isManifestMediaType(""))
+}
+
+func TestOnlyPlatformWithFallback(t *testing.T) {
+	m := OnlyPlatformWithFallback(ocispec.Platform{OS: "linux", Architecture: "arm", Variant: "v7"})
+
+	assert.Assert(t, m.Match(ocispec.Platform{OS: "linux", Architecture: "arm", Variant: "v7"}), "exact match")
+	assert.Assert(t, m.Match(ocispec.Platform{OS: "linux", Architecture: "arm"}), "no variant falls back")
+	assert.Assert(t, !m.Match(ocispec.Platform{OS: "linux", Architecture: "arm", Variant: "v6"}), "different variant does not match")
+	assert.Assert(t, !m.Match(ocispec.Platform{OS: "windows", Architecture: "arm"}), "different OS does not match")
+}
+
+func TestArchFallbackPolicy(t *testing.T) {
+	m := ArchFallbackPolicy{}.Matcher(ocispec.Platform{OS: "linux", Architecture: "amd64"})
+
+	assert.Assert(t, m.Match(ocispec.Platform{OS: "linux", Architecture: "amd64"}), "exact match")
+	assert.Assert(t, m.Match(ocispec.Platform{OS: "linux", Architecture: "386"}), "386 falls back to amd64")
+	assert.Assert(t, !m.Match(ocispec.Platform{OS: "linux", Architecture: "arm64"}), "arm64 is not an amd64 fallback")
+	assert.Assert(t, !m.Match(ocispec.Platform{OS: "windows", Architecture: "386"}), "different OS does not match")
+}
+
+func TestBinfmtHandlerRegisteredUnknownArch(t *testing.T) {
+	assert.Assert(t, !binfmtHandlerRegistered("not-a-real-arch"))
+}
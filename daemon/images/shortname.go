@@ -0,0 +1,139 @@
+package images
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"github.com/distribution/reference"
+)
+
+// ShortNameMode controls how GetImage resolves unqualified ("short") image
+// references, such as "alpine" or "library/ubuntu", that do not specify a
+// registry host.
+type ShortNameMode string
+
+const (
+	// ShortNameModeDockerHubOnly resolves short names against Docker Hub
+	// (docker.io) only. This preserves Docker's traditional behavior and is
+	// the default.
+	ShortNameModeDockerHubOnly ShortNameMode = "docker.io-only"
+
+	// ShortNameModeRegistriesSearch resolves short names against an ordered
+	// list of configured registries, mirroring the unqualified-search-registries
+	// behavior of the containers/image registries.conf format.
+	ShortNameModeRegistriesSearch ShortNameMode = "registries-search"
+)
+
+// ErrAmbiguousShortName is returned by ResolveShortName when the daemon is
+// configured with ShortNameModeRegistriesSearch, interactive resolution is
+// not available (the daemon has no terminal to prompt on), and none of the
+// configured registries has a locally-known image for the requested short
+// name, leaving more than one registry still a candidate.
+type ErrAmbiguousShortName struct {
+	Name       string
+	Candidates []string
+}
+
+func (e ErrAmbiguousShortName) Error() string {
+	return fmt.Sprintf("short-name %q could be pulled from multiple registries (%s); qualify the reference with a registry host, e.g. %s/%s", e.Name, strings.Join(e.Candidates, ", "), e.Candidates[0], e.Name)
+}
+
+// shortNameConfig holds the daemon's `short-name-mode` configuration. mode
+// and registries are read and written together, so they're stored behind a
+// single atomic pointer rather than as separate package vars: that keeps a
+// concurrent SetShortNameMode from ever being observed as a new mode paired
+// with the previous call's registries (or vice versa).
+type shortNameConfig struct {
+	mode       ShortNameMode
+	registries []string
+}
+
+// shortNameCfg is configured once via SetShortNameMode, typically from
+// daemon/config at startup, and consulted by ResolveShortName on every
+// GetImage call. It defaults to ShortNameModeDockerHubOnly.
+var shortNameCfg atomic.Pointer[shortNameConfig]
+
+func init() {
+	shortNameCfg.Store(&shortNameConfig{mode: ShortNameModeDockerHubOnly})
+}
+
+// SetShortNameMode configures how GetImage resolves short names for the
+// remainder of the daemon's lifetime. registries is only consulted when mode
+// is ShortNameModeRegistriesSearch, and is tried in order.
+func SetShortNameMode(mode ShortNameMode, registries []string) {
+	shortNameCfg.Store(&shortNameConfig{mode: mode, registries: registries})
+}
+
+// ResolveShortName qualifies refOrID with a registry host when it doesn't
+// already have one, according to the daemon's configured ShortNameMode. It
+// returns refOrID unchanged if it already specifies a host, is a bare digest
+// or image ID, or the daemon is in ShortNameModeDockerHubOnly (docker.io
+// qualification of hostless references is handled downstream by
+// github.com/distribution/reference, as it always has been).
+//
+// In ShortNameModeRegistriesSearch, the configured registries are tried in
+// order: refOrID is qualified with each in turn, and the first one for which
+// i's reference store already has a local image wins, mirroring the
+// containers/image unqualified-search-registries behavior. If none of them
+// has a locally-known match, a single configured registry is still used (the
+// daemon has nothing else to offer), but more than one leaves the reference
+// genuinely ambiguous and ErrAmbiguousShortName is returned instead of
+// guessing.
+func (i *ImageService) ResolveShortName(refOrID string) (string, error) {
+	cfg := shortNameCfg.Load()
+	if cfg.mode != ShortNameModeRegistriesSearch || isQualifiedOrUnnamed(refOrID) {
+		return refOrID, nil
+	}
+
+	if len(cfg.registries) == 0 {
+		return "", fmt.Errorf("short-name-mode is %q but no search registries are configured", ShortNameModeRegistriesSearch)
+	}
+
+	for _, registry := range cfg.registries {
+		candidate := registry + "/" + refOrID
+		named, err := reference.ParseNormalizedNamed(candidate)
+		if err != nil {
+			continue
+		}
+		if _, err := i.referenceStore.Get(named); err == nil {
+			return candidate, nil
+		}
+	}
+
+	if len(cfg.registries) == 1 {
+		return cfg.registries[0] + "/" + refOrID, nil
+	}
+
+	return "", ErrAmbiguousShortName{Name: refOrID, Candidates: cfg.registries}
+}
+
+// isQualifiedOrUnnamed reports whether refOrID already names an explicit
+// registry host, or is not a repository name at all (a bare digest or an
+// image ID), in which case short-name resolution does not apply.
+func isQualifiedOrUnnamed(refOrID string) bool {
+	if ref, err := reference.ParseAnyReference(refOrID); err == nil {
+		if _, ok := ref.(reference.Named); !ok {
+			// A full 64-char image ID or a "sha256:..." digest.
+			return true
+		}
+	}
+	name, _, _ := strings.Cut(refOrID, "@")
+
+	// Only split on the first "/": whatever precedes it is the candidate
+	// host (or Docker Hub user/org), and since a tag can only follow the
+	// *last* "/", it never appears in that first segment — so there's no
+	// need to separately strip a tag/digest suffix before inspecting it.
+	// Cutting on the first ":" instead, as this used to, mistook a host's
+	// own port separator (e.g. "registry:5000/foo") for a tag separator.
+	firstSegment, rest, found := strings.Cut(name, "/")
+	if !found {
+		// A single path segment, e.g. "alpine" or a bare 64-char image ID,
+		// is never host-qualified.
+		return false
+	}
+	// A registry host is distinguished from a Docker Hub user/org name by
+	// containing a "." or ":", or being exactly "localhost" (the same rule
+	// github.com/distribution/reference uses).
+	return rest != "" && (strings.ContainsAny(firstSegment, ".:") || firstSegment == "localhost")
+}
@@ -0,0 +1,35 @@
+package images
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestIsQualifiedOrUnnamed(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		ref  string
+		want bool
+	}{
+		{name: "bare name", ref: "alpine", want: false},
+		{name: "hub user/repo", ref: "library/alpine", want: false},
+		{name: "bare digest", ref: "sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", want: true},
+		{name: "localhost", ref: "localhost/foo", want: true},
+		{name: "host with port", ref: "registry:5000/foo", want: true},
+		{name: "host with dot", ref: "example.com/foo", want: true},
+		{name: "tagged hub repo", ref: "library/alpine:latest", want: false},
+		{name: "tagged qualified repo", ref: "example.com/foo:latest", want: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, isQualifiedOrUnnamed(tc.ref), tc.want)
+		})
+	}
+}
+
+func TestErrAmbiguousShortNameError(t *testing.T) {
+	err := ErrAmbiguousShortName{Name: "alpine", Candidates: []string{"a.example.com", "b.example.com"}}
+	assert.ErrorContains(t, err, "alpine")
+	assert.ErrorContains(t, err, "a.example.com")
+	assert.ErrorContains(t, err, "b.example.com")
+}
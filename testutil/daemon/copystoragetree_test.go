@@ -0,0 +1,43 @@
+package daemon
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestCopyStorageTreeCopyOnly(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+
+	assert.NilError(t, os.MkdirAll(filepath.Join(src, "sub"), 0o755))
+	assert.NilError(t, os.WriteFile(filepath.Join(src, "sub", "file"), []byte("hello"), 0o644))
+
+	assert.NilError(t, copyStorageTree(src, dst, copyOnly))
+
+	data, err := os.ReadFile(filepath.Join(dst, "sub", "file"))
+	assert.NilError(t, err)
+	assert.Equal(t, string(data), "hello")
+
+	var srcStat, dstStat syscall.Stat_t
+	assert.NilError(t, syscall.Stat(filepath.Join(src, "sub", "file"), &srcStat))
+	assert.NilError(t, syscall.Stat(filepath.Join(dst, "sub", "file"), &dstStat))
+	assert.Assert(t, srcStat.Ino != dstStat.Ino, "copyOnly must not share an inode with the source")
+}
+
+func TestCopyStorageTreePreferHardlink(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+
+	assert.NilError(t, os.WriteFile(filepath.Join(src, "file"), []byte("hello"), 0o644))
+
+	assert.NilError(t, copyStorageTree(src, dst, preferHardlink))
+
+	var srcStat, dstStat syscall.Stat_t
+	assert.NilError(t, syscall.Stat(filepath.Join(src, "file"), &srcStat))
+	assert.NilError(t, syscall.Stat(filepath.Join(dst, "file"), &dstStat))
+	assert.Equal(t, srcStat.Ino, dstStat.Ino, "preferHardlink should share an inode when src and dst are on the same filesystem")
+}
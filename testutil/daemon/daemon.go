@@ -9,6 +9,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/fs"
+	"net"
 	"net/http"
 	"os"
 	"os/exec"
@@ -17,6 +19,7 @@ import (
 	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"testing"
 	"time"
@@ -92,6 +95,10 @@ type Daemon struct {
 	usernsRemap                string
 	rootlessUser               *user.User
 	rootlessXDGRuntimeDir      string
+	sshHost                    *sshHostConfig
+	snapshotName               string
+	snapshotSeed               func(context.Context, testing.TB)
+	configFilePath             string
 	resolvConfContent          string
 	ResolvConfPathOverride     string // Path to a replacement for "/etc/resolv.conf", or empty.
 
@@ -204,6 +211,11 @@ func NewDaemon(workingDir string, ops ...Option) (*Daemon, error) {
 		d.containerdSocket = ""
 	}
 
+	d.configFilePath = filepath.Join(d.Folder, "daemon.json")
+	if err := os.WriteFile(d.configFilePath, []byte("{}\n"), 0o644); err != nil {
+		return nil, errors.Wrapf(err, "failed to write daemon config file %q", d.configFilePath)
+	}
+
 	return d, nil
 }
 
@@ -243,6 +255,61 @@ func New(t testing.TB, ops ...Option) *Daemon {
 	return d
 }
 
+// NewRootlessDaemon returns a Daemon instance configured to run under the
+// unprivileged user identified by username, launched through
+// dockerd-rootless.sh instead of dockerd directly. It otherwise behaves like
+// NewDaemon. Callers should check RequireRootless(t) first so that the test
+// is skipped, rather than failed, on hosts that can't set up the user
+// namespace rootlesskit needs.
+func NewRootlessDaemon(workingDir, username string, ops ...Option) (*Daemon, error) {
+	return NewDaemon(workingDir, append([]Option{WithRootless(username)}, ops...)...)
+}
+
+// WithRootless configures the daemon to run under the unprivileged user
+// identified by username, the same way New does when $DOCKER_ROOTLESS is set.
+// It also points DOCKER_HOST at the daemon's own socket, for any helper
+// process that shells out to the docker CLI instead of using NewClientT.
+func WithRootless(username string) Option {
+	return func(d *Daemon) {
+		WithRootlessUser(username)(d)
+		d.SetEnvVar("DOCKER_HOST", d.Sock())
+	}
+}
+
+// RequireRootless skips t unless the host can run a rootless daemon: the
+// newuidmap/newgidmap setuid helpers rootlesskit needs to set up the user
+// namespace must be installed, and /etc/subuid must exist (its entries are
+// not inspected). It's a no-op when the test process itself is already
+// unprivileged, since dockerd-rootless.sh doesn't need those helpers in
+// that case.
+func RequireRootless(t testing.TB) {
+	t.Helper()
+	if os.Getuid() != 0 {
+		return
+	}
+	for _, bin := range []string{"newuidmap", "newgidmap"} {
+		if _, err := exec.LookPath(bin); err != nil {
+			t.Skipf("rootless daemon requires %s, which is not installed", bin)
+		}
+	}
+	if _, err := os.Stat("/etc/subuid"); err != nil {
+		t.Skip("rootless daemon requires /etc/subuid entries for the rootless user")
+	}
+}
+
+// WithSnapshot configures d to use StartWithSnapshot: the first time a
+// daemon built with this name is started, seed runs against it and the
+// resulting storage tree is cached under name; daemons started later with
+// the same name restore that cached tree instead of re-running seed. This
+// is for cutting fixture time in suites that repeatedly need the same warm
+// daemon state (e.g. busybox already loaded).
+func WithSnapshot(name string, seed func(ctx context.Context, t testing.TB)) Option {
+	return func(d *Daemon) {
+		d.snapshotName = name
+		d.snapshotSeed = seed
+	}
+}
+
 // BinaryPath returns the binary and its arguments.
 func (d *Daemon) BinaryPath() (string, error) {
 	dockerdBinary, err := exec.LookPath(d.dockerdBinary)
@@ -304,9 +371,18 @@ func (d *Daemon) NewClientT(t testing.TB, extraOpts ...client.Opt) *client.Clien
 
 // NewClient creates new client based on daemon's socket path
 func (d *Daemon) NewClient(extraOpts ...client.Opt) (*client.Client, error) {
-	clientOpts := []client.Opt{
-		client.FromEnv,
-		client.WithHost(d.Sock()),
+	clientOpts := []client.Opt{client.FromEnv}
+	if d.sshHost != nil {
+		cfg, err := d.getSSHClientConfig()
+		if err != nil {
+			return nil, err
+		}
+		clientOpts = append(clientOpts,
+			client.WithHost("tcp://"+cfg.addr),
+			client.WithHTTPClient(&http.Client{Transport: cfg.transport}),
+		)
+	} else {
+		clientOpts = append(clientOpts, client.WithHost(d.Sock()))
 	}
 	clientOpts = append(clientOpts, extraOpts...)
 
@@ -336,9 +412,21 @@ func (d *Daemon) TailLogsT(t LogT, n int) {
 }
 
 // PollCheckLogs is a poll.Check that checks the daemon logs using the passed in match function.
+//
+// Unlike a poll.Check built directly on ScanLogs, which re-reads the whole
+// log file from the start on every tick, PollCheckLogs uses FollowLogs to
+// remember how far it has already read across ticks. This keeps polling fast
+// once the log file has grown large (swarm, iptables reload, and image-pull
+// tests can produce many MB of log), and keeps match functions like
+// ScanLogsMatchCount from re-counting lines seen on an earlier tick.
 func (d *Daemon) PollCheckLogs(ctx context.Context, match func(s string) bool) poll.Check {
+	offset, err := d.LogOffset()
 	return func(t poll.LogT) poll.Result {
-		ok, _, err := d.ScanLogs(ctx, match)
+		if err != nil {
+			return poll.Error(err)
+		}
+		var ok bool
+		ok, _, offset, err = d.FollowLogs(ctx, offset, match)
 		if err != nil {
 			return poll.Error(err)
 		}
@@ -389,6 +477,74 @@ func (d *Daemon) ScanLogsT(ctx context.Context, t testing.TB, match func(s strin
 	return ok, line
 }
 
+// LogOffset returns the current size of the daemon's log file, for use as
+// the starting offset of a later FollowLogs call.
+func (d *Daemon) LogOffset() (int64, error) {
+	stat, err := d.logFile.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return stat.Size(), nil
+}
+
+// followLogsPollInterval is how long FollowLogs waits, after hitting EOF
+// with no match, before checking once more for data that arrived in the
+// meantime. It is a variable so tests of FollowLogs itself can shorten it.
+var followLogsPollInterval = 50 * time.Millisecond
+
+// FollowLogs reads the daemon log file incrementally starting at offset,
+// passing each complete line to match, and returns as soon as match returns
+// true. Unlike ScanLogs, which re-reads the log file from the start on every
+// call, FollowLogs only ever looks at lines at or after offset, so repeated
+// calls (e.g. from successive PollCheckLogs ticks) don't re-scan a log file
+// that has grown to many MB, and don't cause a ScanLogsMatchCount-style
+// match function to double-count a line seen by an earlier call.
+//
+// If EOF is reached without a match, FollowLogs waits up to
+// followLogsPollInterval for more data to be written and makes one more
+// pass before giving up for this call, so a short-lived burst of output
+// split across two writes isn't missed. It returns the offset the read
+// stopped at, to be passed to the next call.
+func (d *Daemon) FollowLogs(ctx context.Context, offset int64, match func(s string) bool) (bool, string, int64, error) {
+	f, err := os.Open(d.logFile.Name())
+	if err != nil {
+		return false, "", offset, errors.Wrap(err, "error opening daemon log file")
+	}
+	defer f.Close()
+
+	for attempt := 0; ; attempt++ {
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			return false, "", offset, err
+		}
+
+		r := bufio.NewReader(f)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				if !errors.Is(err, io.EOF) {
+					return false, "", offset, err
+				}
+				break
+			}
+			offset += int64(len(line))
+			line = strings.TrimSuffix(line, "\n")
+			if match(line) {
+				return true, line, offset, nil
+			}
+		}
+
+		if attempt > 0 {
+			return false, "", offset, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return false, "", offset, ctx.Err()
+		case <-time.After(followLogsPollInterval):
+		}
+	}
+}
+
 // ScanLogs scans the daemon logs and passes each line to the match function.
 func (d *Daemon) ScanLogs(ctx context.Context, match func(s string) bool) (bool, string, error) {
 	stat, err := d.logFile.Stat()
@@ -411,6 +567,103 @@ func (d *Daemon) ScanLogs(ctx context.Context, match func(s string) bool) (bool,
 	return false, "", scanner.Err()
 }
 
+// LogEntry is a single structured log line, as produced when dockerd is
+// started with --log-format=json. Fields holds whatever extra key/value
+// pairs the line carried beyond the well-known ones below (e.g. fields
+// added via logrus' WithField/WithFields).
+type LogEntry struct {
+	Level  string
+	Msg    string
+	Time   string
+	Error  string
+	Fields map[string]any
+}
+
+// parseLogLine decodes a single daemon log line into a LogEntry. Lines that
+// aren't valid JSON (e.g. the daemon is running with the default
+// --log-format=text) are treated as a LogEntry with only Msg set, so
+// ScanLogsJSON can be used regardless of the daemon's configured log format.
+func parseLogLine(line string) LogEntry {
+	var raw map[string]any
+	if err := json.Unmarshal([]byte(line), &raw); err != nil {
+		return LogEntry{Msg: line}
+	}
+
+	e := LogEntry{Fields: make(map[string]any, len(raw))}
+	for k, v := range raw {
+		switch k {
+		case "level":
+			e.Level, _ = v.(string)
+		case "msg":
+			e.Msg, _ = v.(string)
+		case "time":
+			e.Time, _ = v.(string)
+		case "error":
+			e.Error, _ = v.(string)
+		default:
+			e.Fields[k] = v
+		}
+	}
+	return e
+}
+
+// ScanLogsJSON scans the daemon logs like ScanLogs, but parses each line as a
+// structured LogEntry before passing it to match, so tests can assert on
+// logrus fields (e.g. a specific error value) instead of doing fragile
+// substring matching that risks false positives when the text happens to
+// appear inside an unrelated field.
+func (d *Daemon) ScanLogsJSON(ctx context.Context, match func(LogEntry) bool) (bool, string, error) {
+	stat, err := d.logFile.Stat()
+	if err != nil {
+		return false, "", err
+	}
+	rdr := io.NewSectionReader(d.logFile, 0, stat.Size())
+
+	scanner := bufio.NewScanner(rdr)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if match(parseLogLine(line)) {
+			return true, line, nil
+		}
+		select {
+		case <-ctx.Done():
+			return false, "", ctx.Err()
+		default:
+		}
+	}
+	return false, "", scanner.Err()
+}
+
+// ScanLogsMatchField returns a function that can be used with ScanLogsJSON to
+// match a structured log entry carrying the given field key and value. The
+// well-known keys "level", "msg", "time", and "error" are compared against
+// their typed LogEntry fields; any other key is looked up in LogEntry.Fields.
+func ScanLogsMatchField(key string, value any) func(LogEntry) bool {
+	return func(e LogEntry) bool {
+		switch key {
+		case "level":
+			return e.Level == value
+		case "msg":
+			return e.Msg == value
+		case "time":
+			return e.Time == value
+		case "error":
+			return e.Error == value
+		default:
+			v, ok := e.Fields[key]
+			return ok && v == value
+		}
+	}
+}
+
+// ScanLogsMatchLevel returns a function that can be used with ScanLogsJSON to
+// match a structured log entry logged at the given level (e.g. "error").
+func ScanLogsMatchLevel(level string) func(LogEntry) bool {
+	return func(e LogEntry) bool {
+		return e.Level == level
+	}
+}
+
 // TailLogs tails N lines from the daemon logs
 func (d *Daemon) TailLogs(n int) ([][]byte, error) {
 	logF, err := os.Open(d.logFile.Name())
@@ -478,8 +731,10 @@ func (d *Daemon) StartWithLogFile(out *os.File, providedArgs ...string) error {
 	}
 
 	d.args = append(d.args,
-		// Make sure we don't use the environment-provided global config file.
-		"--config-file", "/dev/null",
+		// Use a per-daemon config file, rather than the environment-provided
+		// global one, so that StartRegistry and friends can rewrite it and
+		// have ReloadConfig pick up the change.
+		"--config-file", d.configFilePath,
 		"--data-root", d.Root,
 		"--exec-root", d.execRoot,
 		"--pidfile", d.pidFile,
@@ -552,6 +807,22 @@ func (d *Daemon) StartWithLogFile(out *os.File, providedArgs ...string) error {
 		setsid(cmd)
 	}
 
+	// dockerd notifies readiness via sd_notify (READY=1) when NOTIFY_SOCKET
+	// is set, same as it would under systemd. Racing that against the HTTP
+	// ping loop below lets Start return as soon as the daemon says it's
+	// ready, rather than waiting for the next 500ms ping tick, and the
+	// STATUS= messages it sends along the way (e.g. "Binding socket to ...",
+	// "Loading containers") give start failures a reason beyond "daemon
+	// exited during startup".
+	notify, err := newNotifySocket(d.id)
+	if err != nil {
+		d.log.Logf("[%s] could not create sd_notify socket, falling back to HTTP-only readiness check: %v", d.id, err)
+	} else {
+		defer notify.Close()
+		cmd.Env = append(cmd.Env, "NOTIFY_SOCKET="+notify.addr)
+		go notify.run()
+	}
+
 	if err := cmd.Start(); err != nil {
 		return errors.Wrapf(err, "[%s] could not start daemon container", d.id)
 	}
@@ -593,9 +864,16 @@ func (d *Daemon) StartWithLogFile(out *os.File, providedArgs ...string) error {
 
 		select {
 		case <-ctx.Done():
-			return errors.Wrapf(ctx.Err(), "[%s] daemon exited and never started", d.id)
+			return errors.Wrapf(ctx.Err(), "[%s] daemon exited and never started%s", d.id, notify.statusSuffix())
 		case err := <-d.Wait:
-			return errors.Wrapf(err, "[%s] daemon exited during startup", d.id)
+			return errors.Wrapf(err, "[%s] daemon exited during startup%s", d.id, notify.statusSuffix())
+		case <-notify.ready():
+			d.log.Logf("[%s] daemon ready (sd_notify READY=1)\n", d.id)
+			d.Root, err = d.queryRootDir()
+			if err != nil {
+				return errors.Wrapf(err, "[%s] error querying daemon for root directory", d.id)
+			}
+			return nil
 		default:
 			rctx, rcancel := context.WithTimeout(context.TODO(), 2*time.Second)
 			defer rcancel()
@@ -608,6 +886,7 @@ func (d *Daemon) StartWithLogFile(out *os.File, providedArgs ...string) error {
 
 				select {
 				case <-ctx.Done():
+				case <-notify.ready():
 				case <-time.After(500 * time.Millisecond):
 				}
 				continue
@@ -635,6 +914,55 @@ func (d *Daemon) StartWithBusybox(ctx context.Context, t testing.TB, arg ...stri
 	d.LoadBusybox(ctx, t)
 }
 
+// StartWithSnapshot starts the daemon, using the name given to WithSnapshot
+// to avoid reseeding storage that a previous daemon already prepared: if a
+// snapshot by that name exists in the snapshot cache, it's restored before
+// start; otherwise the daemon is started normally, the seed func given to
+// WithSnapshot runs against it, and the result is snapshotted for the next
+// daemon to restore. d must have been built with WithSnapshot; if it
+// wasn't, this just starts the daemon.
+func (d *Daemon) StartWithSnapshot(ctx context.Context, t testing.TB) {
+	t.Helper()
+	if d.snapshotName == "" {
+		d.Start(t)
+		return
+	}
+
+	ok, err := d.hasSnapshot(d.snapshotName)
+	assert.NilError(t, err, "[%s] error checking for snapshot %q", d.id, d.snapshotName)
+	if ok {
+		assert.NilError(t, d.Restore(d.snapshotName), "[%s] failed to restore snapshot %q", d.id, d.snapshotName)
+		d.Start(t)
+		return
+	}
+
+	d.Start(t)
+	if d.snapshotSeed != nil {
+		d.snapshotSeed(ctx, t)
+	}
+	d.Stop(t)
+	assert.NilError(t, d.Snapshot(d.snapshotName), "[%s] failed to snapshot %q", d.id, d.snapshotName)
+	// Snapshot may have hardlinked the cache straight out of d.Root. Restore
+	// back over d.Root before starting again, so the live tree this daemon
+	// is about to write to shares no inode with the cache other tests will
+	// later restore from.
+	assert.NilError(t, d.Restore(d.snapshotName), "[%s] failed to restore snapshot %q after seeding", d.id, d.snapshotName)
+	d.Start(t)
+}
+
+// processSignal sends sig to the daemon. For a rootless daemon, d.cmd is the
+// "sudo" wrapper rather than dockerd itself, and unlike SIGINT/SIGTERM,
+// SIGKILL can't be trapped and forwarded by a signal handler, so sudo exiting
+// would otherwise leave dockerd-rootless.sh/rootlesskit/dockerd running as
+// orphans. setsid (see StartWithLogFile) makes the sudo process the leader of
+// its own process group, so signaling the whole group reaches all of them.
+func (d *Daemon) processSignal(sig syscall.Signal) error {
+	if d.rootlessUser != nil {
+		return syscall.Kill(-d.cmd.Process.Pid, sig)
+	}
+	return d.cmd.Process.Signal(sig)
+}
+
 // Kill will send a SIGKILL to the daemon
 func (d *Daemon) Kill() error {
 	if d.cmd == nil || d.Wait == nil {
@@ -646,7 +974,7 @@ func (d *Daemon) Kill() error {
 		d.cmd = nil
 	}()
 
-	if err := d.cmd.Process.Kill(); err != nil {
+	if err := d.processSignal(syscall.SIGKILL); err != nil {
 		return err
 	}
 
@@ -676,6 +1004,9 @@ func (d *Daemon) Signal(signal os.Signal) error {
 	if d.cmd == nil || d.Wait == nil {
 		return errDaemonNotStarted
 	}
+	if sig, ok := signal.(syscall.Signal); ok {
+		return d.processSignal(sig)
+	}
 	return d.cmd.Process.Signal(signal)
 }
 
@@ -732,7 +1063,7 @@ func (d *Daemon) StopWithError() (retErr error) {
 
 	d.log.Logf("[%s] stopping daemon", d.id)
 
-	if err := d.cmd.Process.Signal(os.Interrupt); err != nil {
+	if err := d.processSignal(syscall.SIGINT); err != nil {
 		if errors.Is(err, os.ErrProcessDone) {
 			return errDaemonNotStarted
 		}
@@ -763,13 +1094,13 @@ out2:
 				break out2
 			}
 			d.log.Logf("[%d] attempt #%d/5: daemon is still running with pid %d", i, d.cmd.Process.Pid)
-			if err := d.cmd.Process.Signal(os.Interrupt); err != nil {
+			if err := d.processSignal(syscall.SIGINT); err != nil {
 				return errors.Wrapf(err, "[%s] attempt #%d/5 could not send signal", d.id, i)
 			}
 		}
 	}
 
-	if err := d.cmd.Process.Kill(); err != nil {
+	if err := d.processSignal(syscall.SIGKILL); err != nil {
 		d.log.Logf("[%s] failed to kill daemon: %v", d.id, err)
 		return err
 	}
@@ -804,23 +1135,125 @@ func (d *Daemon) handleUserns() {
 	}
 }
 
+// notifySocket listens on an abstract unix datagram socket for the sd_notify
+// protocol messages ("READY=1", "STATUS=...") that dockerd sends when
+// NOTIFY_SOCKET is set in its environment, same as it would under systemd.
+type notifySocket struct {
+	addr string
+	conn *net.UnixConn
+
+	readyCh chan struct{}
+	once    sync.Once
+
+	mu     sync.Mutex
+	status string
+}
+
+// newNotifySocket creates a notifySocket listening on an abstract address
+// (avoiding the 108-byte path limit unix sockets are otherwise subject to,
+// and needing no cleanup on disk) scoped to the given daemon id.
+func newNotifySocket(id string) (*notifySocket, error) {
+	addr := "@dockerd-notify-" + id + ".sock"
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Net: "unixgram", Name: addr})
+	if err != nil {
+		return nil, err
+	}
+	return &notifySocket{
+		addr:    addr,
+		conn:    conn,
+		readyCh: make(chan struct{}),
+	}, nil
+}
+
+// run reads sd_notify messages until the socket is closed. It's meant to be
+// called in its own goroutine.
+func (n *notifySocket) run() {
+	buf := make([]byte, 4096)
+	for {
+		nr, err := n.conn.Read(buf)
+		if err != nil {
+			return
+		}
+		for _, line := range strings.Split(string(buf[:nr]), "\n") {
+			switch {
+			case line == "READY=1":
+				n.once.Do(func() { close(n.readyCh) })
+			case strings.HasPrefix(line, "STATUS="):
+				n.mu.Lock()
+				n.status = strings.TrimPrefix(line, "STATUS=")
+				n.mu.Unlock()
+			}
+		}
+	}
+}
+
+// ready returns a channel that's closed once a READY=1 message has been
+// received. It is safe to call on a nil *notifySocket (e.g. because the
+// socket couldn't be created), in which case it returns a nil channel, so a
+// select on it simply never fires and callers fall back to HTTP-only
+// readiness checking.
+func (n *notifySocket) ready() <-chan struct{} {
+	if n == nil {
+		return nil
+	}
+	return n.readyCh
+}
+
+// statusSuffix returns a human-readable "(last status: ...)" suffix for the
+// most recent STATUS= message, or "" if none has been received yet (or n is
+// nil). It's meant to be appended to start-failure error messages.
+func (n *notifySocket) statusSuffix() string {
+	if n == nil {
+		return ""
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.status == "" {
+		return ""
+	}
+	return fmt.Sprintf(" (last status: %q)", n.status)
+}
+
+// Close stops listening for sd_notify messages.
+func (n *notifySocket) Close() error {
+	if n == nil {
+		return nil
+	}
+	return n.conn.Close()
+}
+
 // ReloadConfig asks the daemon to reload its configuration
 func (d *Daemon) ReloadConfig() error {
-	if d.cmd == nil || d.cmd.Process == nil {
+	if d.sshHost == nil && (d.cmd == nil || d.cmd.Process == nil) {
 		return errors.New("daemon is not running")
 	}
 
+	clientConfig, err := d.getClientConfig()
+	if err != nil {
+		return err
+	}
+
 	errCh := make(chan error, 1)
 	started := make(chan struct{})
 	go func() {
-		_, body, err := request.Get(context.TODO(), "/events", request.Host(d.Sock()))
+		httpClient := &http.Client{Transport: clientConfig.transport}
+		req, err := http.NewRequest(http.MethodGet, "/events", http.NoBody)
+		if err != nil {
+			close(started)
+			errCh <- err
+			return
+		}
+		req.URL.Host = clientConfig.addr
+		req.URL.Scheme = clientConfig.scheme
+
+		resp, err := httpClient.Do(req)
 		close(started)
 		if err != nil {
 			errCh <- err
 			return
 		}
-		defer body.Close()
-		dec := json.NewDecoder(body)
+		defer resp.Body.Close()
+		dec := json.NewDecoder(resp.Body)
 		for {
 			var e events.Message
 			if err := dec.Decode(&e); err != nil {
@@ -839,7 +1272,11 @@ func (d *Daemon) ReloadConfig() error {
 	}()
 
 	<-started
-	if err := signalDaemonReload(d.cmd.Process.Pid); err != nil {
+	if d.sshHost != nil {
+		if err := d.sshSignalReload(); err != nil {
+			return errors.Wrapf(err, "[%s] error signaling daemon reload over SSH", d.id)
+		}
+	} else if err := signalDaemonReload(d.cmd.Process.Pid); err != nil {
 		return errors.Wrapf(err, "[%s] error signaling daemon reload", d.id)
 	}
 	select {
@@ -888,6 +1325,10 @@ func (d *Daemon) LoadImage(ctx context.Context, t testing.TB, img string) {
 }
 
 func (d *Daemon) getClientConfig() (*clientConfig, error) {
+	if d.sshHost != nil {
+		return d.getSSHClientConfig()
+	}
+
 	var (
 		transport *http.Transport
 		scheme    string
@@ -1012,6 +1453,45 @@ func (d *Daemon) FirewallReloadedAt(t testing.TB) string {
 	return ""
 }
 
+// TriggerFirewallReload flushes the host firewall ruleset out from under the
+// running daemon, the same disruption a `systemctl reload firewalld` or
+// `nft flush ruleset` causes, so a test can then use WaitFirewallReload to
+// verify the daemon notices and restores its rules.
+func (d *Daemon) TriggerFirewallReload(ctx context.Context, t testing.TB) {
+	t.Helper()
+	var cmd *exec.Cmd
+	switch d.FirewallBackendDriver(t) {
+	case "nftables":
+		cmd = exec.CommandContext(ctx, "nft", "flush", "ruleset")
+	default:
+		cmd = exec.CommandContext(ctx, "iptables", "-F")
+	}
+	out, err := cmd.CombinedOutput()
+	assert.NilError(t, err, "[%s] failed to flush host firewall ruleset: %s", d.id, out)
+}
+
+// WaitFirewallReload captures the daemon's current FirewallReloadedAt
+// timestamp, then polls Info until it reports a newer one, for verifying
+// iptables/nftables restoration after a host-firewall flush
+// (TriggerFirewallReload, or an external `firewalld` reload). It times out
+// after 30 seconds, matching ReloadConfig's timeout for the analogous
+// SIGHUP-triggered reload.
+func (d *Daemon) WaitFirewallReload(ctx context.Context, t testing.TB) {
+	t.Helper()
+	before := d.FirewallReloadedAt(t)
+	poll.WaitOn(t, func(poll.LogT) poll.Result {
+		select {
+		case <-ctx.Done():
+			return poll.Error(ctx.Err())
+		default:
+		}
+		if after := d.FirewallReloadedAt(t); after != "" && after != before {
+			return poll.Success()
+		}
+		return poll.Continue("[%s] waiting for firewall reload", d.id)
+	}, poll.WithTimeout(30*time.Second))
+}
+
 // TamperWithContainerConfig modifies the on-disk config of a container.
 func (d *Daemon) TamperWithContainerConfig(t testing.TB, containerID string, tamper func(*container.Container)) {
 	t.Helper()
@@ -1050,6 +1530,27 @@ func cleanupRaftDir(t testing.TB, d *Daemon) {
 // removes the "containers" sub-directory.
 func cleanupDaemonStorage(t testing.TB, d *Daemon) {
 	t.Helper()
+	dirs := append(d.storageDirs(), "tmp")
+
+	for _, p := range dirs {
+		dir := filepath.Join(d.Root, p)
+		if err := os.RemoveAll(dir); err != nil {
+			t.Logf("[%s] error removing %v: %v", d.id, dir, err)
+		}
+	}
+
+	if d.rootlessUser != nil && d.rootlessXDGRuntimeDir != "" {
+		if err := os.RemoveAll(d.rootlessXDGRuntimeDir); err != nil {
+			t.Logf("[%s] error removing rootless XDG_RUNTIME_DIR %v: %v", d.id, d.rootlessXDGRuntimeDir, err)
+		}
+	}
+}
+
+// storageDirs returns the per-daemon storage subdirectories that
+// cleanupDaemonStorage, Snapshot, and Restore all operate on: everything a
+// fresh daemon would otherwise have to rebuild (or re-pull/re-load) from
+// scratch if it were missing.
+func (d *Daemon) storageDirs() []string {
 	dirs := []string{
 		"builder",
 		"buildkit",
@@ -1057,18 +1558,180 @@ func cleanupDaemonStorage(t testing.TB, d *Daemon) {
 		"image",
 		"network",
 		"plugins",
-		"tmp",
 		"trust",
 		"volumes",
+	}
+	if d.storageDriver != "" {
 		// note: this assumes storage-driver name matches the subdirectory,
 		// which is currently true, but not guaranteed.
-		d.storageDriver,
+		dirs = append(dirs, d.storageDriver)
 	}
+	return dirs
+}
 
-	for _, p := range dirs {
-		dir := filepath.Join(d.Root, p)
-		if err := os.RemoveAll(dir); err != nil {
-			t.Logf("[%s] error removing %v: %v", d.id, dir, err)
+// snapshotRoot returns the directory Snapshot and Restore cache storage
+// trees under name in. It is a fixed path under os.TempDir, so it is shared
+// by every daemon (in this test process or another) that uses the same
+// name, and a WithSnapshot seeded by one daemon can be restored by another.
+// Nothing here removes it afterwards.
+func (d *Daemon) snapshotRoot(name string) string {
+	return filepath.Join(os.TempDir(), "docker-integration-snapshots", name)
+}
+
+// hasSnapshot reports whether a snapshot named name exists in the snapshot
+// cache.
+func (d *Daemon) hasSnapshot(name string) (bool, error) {
+	_, err := os.Stat(d.snapshotRoot(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Snapshot takes a snapshot, named name, of the daemon's storage tree (see
+// storageDirs), for a later Restore to use. Files are hardlinked into the
+// snapshot cache by path (copied where src and the cache are on different
+// filesystems); the snapshot is not content-addressed, and identical files
+// are not deduplicated. The
+// daemon must be stopped: copying a live graph driver's files risks
+// capturing a subdirectory mid-write.
+func (d *Daemon) Snapshot(name string) error {
+	if d.cmd != nil {
+		return errors.Errorf("[%s] cannot snapshot storage while the daemon is running", d.id)
+	}
+
+	dst := d.snapshotRoot(name)
+	if err := os.RemoveAll(dst); err != nil {
+		return errors.Wrapf(err, "[%s] failed to clear previous snapshot %q", d.id, name)
+	}
+	if err := os.MkdirAll(dst, 0o755); err != nil {
+		return errors.Wrapf(err, "[%s] failed to create snapshot %q", d.id, name)
+	}
+
+	for _, dir := range d.storageDirs() {
+		src := filepath.Join(d.Root, dir)
+		if _, err := os.Stat(src); errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err := copyStorageTree(src, filepath.Join(dst, dir), preferHardlink); err != nil {
+			return errors.Wrapf(err, "[%s] failed to snapshot %q", d.id, dir)
+		}
+	}
+	return nil
+}
+
+// Restore replaces the daemon's storage tree (see storageDirs) with the
+// content previously saved by Snapshot(name). The daemon must be stopped.
+//
+// This always copies bytes rather than hardlinking: the destination is
+// about to become mutable again once the daemon starts, and a hardlink
+// back into the shared snapshot cache would let the daemon's first
+// in-place write (its bolt databases, repositories.json, overlay2
+// metadata, ...) corrupt that cache for every other test that later
+// restores the same name.
+func (d *Daemon) Restore(name string) error {
+	if d.cmd != nil {
+		return errors.Errorf("[%s] cannot restore storage while the daemon is running", d.id)
+	}
+
+	src := d.snapshotRoot(name)
+	if _, err := os.Stat(src); err != nil {
+		return errors.Wrapf(err, "[%s] no snapshot %q to restore", d.id, name)
+	}
+
+	for _, dir := range d.storageDirs() {
+		dst := filepath.Join(d.Root, dir)
+		if err := os.RemoveAll(dst); err != nil {
+			return errors.Wrapf(err, "[%s] failed to clear %q before restore", d.id, dir)
+		}
+		srcDir := filepath.Join(src, dir)
+		if _, err := os.Stat(srcDir); errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err := copyStorageTree(srcDir, dst, copyOnly); err != nil {
+			return errors.Wrapf(err, "[%s] failed to restore %q", d.id, dir)
+		}
+	}
+	return nil
+}
+
+// treeCopyMode controls how copyStorageTree handles regular files.
+type treeCopyMode int
+
+const (
+	// preferHardlink hardlinks each regular file where possible, falling
+	// back to a byte-for-byte copy when src and dst don't share a
+	// filesystem (hardlinks can't cross devices). Only safe when dst is
+	// never written to in place afterward, e.g. populating the snapshot
+	// cache from a daemon root that won't be reused.
+	preferHardlink treeCopyMode = iota
+	// copyOnly always makes a fresh, independent copy of each regular
+	// file's bytes. Required whenever dst is about to become mutable, so
+	// it shares no inode with src.
+	copyOnly
+)
+
+// copyStorageTree recursively copies src to dst: directories are recreated,
+// symlinks are reproduced as symlinks, and regular files are handled
+// according to mode.
+func copyStorageTree(src, dst string, mode treeCopyMode) error {
+	return filepath.WalkDir(src, func(path string, de fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		switch {
+		case de.IsDir():
+			info, err := de.Info()
+			if err != nil {
+				return err
+			}
+			return os.MkdirAll(target, info.Mode())
+		case de.Type()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case mode == copyOnly:
+			return copyFile(path, target)
+		default:
+			if err := os.Link(path, target); err != nil {
+				if errors.Is(err, syscall.EXDEV) {
+					return copyFile(path, target)
+				}
+				return err
+			}
+			return nil
 		}
+	})
+}
+
+// copyFile copies src to dst, for use when copyStorageTree can't (or won't)
+// hardlink.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
 	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode())
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, in)
+	return err
 }
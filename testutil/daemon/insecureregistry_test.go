@@ -0,0 +1,45 @@
+package daemon
+
+import (
+	"encoding/json"
+	"testing"
+
+	"gotest.tools/v3/assert"
+	is "gotest.tools/v3/assert/cmp"
+)
+
+// jsonRoundTrip mimics what editConfig does: marshal a config map to JSON
+// and decode it back, so a []string value becomes a []interface{} the way
+// it would after actually going through the daemon's config file.
+func jsonRoundTrip(t *testing.T, cfg map[string]any) map[string]any {
+	t.Helper()
+	b, err := json.Marshal(cfg)
+	assert.NilError(t, err)
+	out := map[string]any{}
+	assert.NilError(t, json.Unmarshal(b, &out))
+	return out
+}
+
+func TestAppendUniqueSurvivesJSONRoundTrip(t *testing.T) {
+	cfg := map[string]any{}
+	cfg["insecure-registries"] = appendUnique(cfg["insecure-registries"], "host1:1111")
+	cfg = jsonRoundTrip(t, cfg)
+
+	cfg["insecure-registries"] = appendUnique(cfg["insecure-registries"], "host2:2222")
+	cfg = jsonRoundTrip(t, cfg)
+
+	assert.Check(t, is.DeepEqual(stringSlice(cfg["insecure-registries"]), []string{"host1:1111", "host2:2222"}))
+}
+
+func TestRemoveStringSurvivesJSONRoundTrip(t *testing.T) {
+	cfg := map[string]any{}
+	cfg["insecure-registries"] = appendUnique(cfg["insecure-registries"], "host1:1111")
+	cfg = jsonRoundTrip(t, cfg)
+	cfg["insecure-registries"] = appendUnique(cfg["insecure-registries"], "host2:2222")
+	cfg = jsonRoundTrip(t, cfg)
+
+	cfg["insecure-registries"] = removeString(cfg["insecure-registries"], "host1:1111")
+	cfg = jsonRoundTrip(t, cfg)
+
+	assert.Check(t, is.DeepEqual(stringSlice(cfg["insecure-registries"]), []string{"host2:2222"}))
+}
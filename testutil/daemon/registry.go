@@ -0,0 +1,486 @@
+package daemon
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/moby/moby/api/types/container"
+	"github.com/moby/moby/api/types/image"
+	"github.com/moby/moby/client"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/bcrypt"
+	"gotest.tools/v3/assert"
+)
+
+// RegistryOption configures Daemon.StartRegistry.
+type RegistryOption func(*registryConfig)
+
+type registryConfig struct {
+	username, password string
+	tls                bool
+	ociMediaTypes      bool
+}
+
+// WithRegistryAuth configures the registry fixture to require HTTP basic
+// auth for username/password, via an htpasswd file mounted into the
+// registry:2 container.
+func WithRegistryAuth(username, password string) RegistryOption {
+	return func(c *registryConfig) {
+		c.username = username
+		c.password = password
+	}
+}
+
+// WithRegistryTLS configures the registry fixture to serve over TLS using a
+// freshly generated CA, which is installed into the daemon's cert.d
+// directory for the registry's host so pulling/pushing against it doesn't
+// need --insecure-registry.
+func WithRegistryTLS() RegistryOption {
+	return func(c *registryConfig) { c.tls = true }
+}
+
+// WithRegistryOCIMediaTypes configures the registry fixture's Manifest helper
+// to request OCI media types (application/vnd.oci.image.*) instead of the
+// Docker-specific equivalents. Push, Pull, and Tag are not affected.
+func WithRegistryOCIMediaTypes() RegistryOption {
+	return func(c *registryConfig) { c.ociMediaTypes = true }
+}
+
+// Registry is a handle to an ephemeral registry:2 container started by
+// Daemon.StartRegistry, torn down automatically at the end of the test that
+// started it.
+type Registry struct {
+	d           *Daemon
+	containerID string
+	host        string // e.g. "127.0.0.1:32881"
+	cfg         registryConfig
+}
+
+// Host returns the "host:port" this registry is reachable at, suitable for
+// qualifying a reference, e.g. r.Host()+"/busybox:latest".
+func (r *Registry) Host() string {
+	return r.host
+}
+
+// StartRegistry launches a registry:2 container on a random port and
+// reconfigures d, via ReloadConfig, so that host is usable as an
+// insecure registry (or, with WithRegistryTLS, a trusted one) without
+// passing --insecure-registry on the command line. The registry and the
+// daemon config change are both torn down in t.Cleanup.
+func (d *Daemon) StartRegistry(t testing.TB, opts ...RegistryOption) *Registry {
+	t.Helper()
+	ctx := context.Background()
+
+	cfg := registryConfig{}
+	for _, o := range opts {
+		o(&cfg)
+	}
+
+	c := d.NewClientT(t)
+
+	env := []string{
+		"REGISTRY_HTTP_ADDR=0.0.0.0:5000",
+		// registry:2 refuses manifest deletes unless this is set.
+		"REGISTRY_STORAGE_DELETE_ENABLED=true",
+	}
+	var htpasswdDir string
+	if cfg.username != "" {
+		var err error
+		htpasswdDir, err = os.MkdirTemp("", "registry-htpasswd")
+		assert.NilError(t, err, "[%s] failed to create htpasswd dir", d.id)
+		t.Cleanup(func() { os.RemoveAll(htpasswdDir) })
+
+		assert.NilError(t, writeHtpasswd(filepath.Join(htpasswdDir, "htpasswd"), cfg.username, cfg.password),
+			"[%s] failed to write htpasswd file", d.id)
+		env = append(env,
+			"REGISTRY_AUTH=htpasswd",
+			"REGISTRY_AUTH_HTPASSWD_REALM=registry",
+			"REGISTRY_AUTH_HTPASSWD_PATH=/auth/htpasswd",
+		)
+	}
+
+	var certDir string
+	if cfg.tls {
+		var err error
+		certDir, err = os.MkdirTemp("", "registry-tls")
+		assert.NilError(t, err, "[%s] failed to create registry cert dir", d.id)
+		t.Cleanup(func() { os.RemoveAll(certDir) })
+
+		assert.NilError(t, generateRegistryCert(certDir), "[%s] failed to generate registry TLS cert", d.id)
+		env = append(env,
+			"REGISTRY_HTTP_TLS_CERTIFICATE=/certs/registry-cert.pem",
+			"REGISTRY_HTTP_TLS_KEY=/certs/registry-key.pem",
+		)
+	}
+
+	reader, err := c.ImagePull(ctx, "registry:2", image.PullOptions{})
+	assert.NilError(t, err, "[%s] failed to pull registry:2", d.id)
+	_, _ = io.Copy(io.Discard, reader)
+	assert.NilError(t, reader.Close())
+
+	hostConfig := &container.HostConfig{
+		PortBindings: map[container.PortRangeProto][]container.PortBinding{
+			"5000/tcp": {{HostIP: "127.0.0.1", HostPort: "0"}},
+		},
+		AutoRemove: true,
+	}
+	if htpasswdDir != "" {
+		hostConfig.Binds = append(hostConfig.Binds, htpasswdDir+":/auth:ro")
+	}
+	if certDir != "" {
+		hostConfig.Binds = append(hostConfig.Binds, certDir+":/certs:ro")
+	}
+
+	created, err := c.ContainerCreate(ctx, &container.Config{
+		Image: "registry:2",
+		Env:   env,
+	}, hostConfig, nil, nil, "")
+	assert.NilError(t, err, "[%s] failed to create registry container", d.id)
+
+	r := &Registry{d: d, containerID: created.ID, cfg: cfg}
+	t.Cleanup(func() {
+		_ = c.ContainerRemove(context.Background(), r.containerID, container.RemoveOptions{Force: true})
+	})
+
+	assert.NilError(t, c.ContainerStart(ctx, created.ID, container.StartOptions{}), "[%s] failed to start registry container", d.id)
+
+	inspect, err := c.ContainerInspect(ctx, created.ID)
+	assert.NilError(t, err, "[%s] failed to inspect registry container", d.id)
+	bindings := inspect.NetworkSettings.Ports["5000/tcp"]
+	assert.Assert(t, len(bindings) > 0, "[%s] registry container published no port for 5000/tcp", d.id)
+	r.host = "127.0.0.1:" + bindings[0].HostPort
+
+	if cfg.tls {
+		assert.NilError(t, d.installRegistryCA(r.host, filepath.Join(certDir, "registry-cert.pem")),
+			"[%s] failed to install registry CA for %s", d.id, r.host)
+		t.Cleanup(func() {
+			_ = os.RemoveAll(filepath.Join(registryCertsDir, r.host))
+		})
+	} else {
+		assert.NilError(t, d.addInsecureRegistry(r.host), "[%s] failed to reconfigure daemon for registry %s", d.id, r.host)
+		t.Cleanup(func() {
+			_ = d.removeInsecureRegistry(r.host)
+		})
+	}
+
+	return r
+}
+
+// registryCertsDir is the directory dockerd consults for a per-registry CA
+// certificate before falling back to insecure-registries, keyed by
+// "host:port" subdirectories.
+const registryCertsDir = "/etc/docker/certs.d"
+
+// installRegistryCA installs the certificate at caPath as the trusted CA
+// for host (e.g. "127.0.0.1:32881") in this daemon's certs.d directory, so
+// pulls/pushes against host verify the registry's certificate against our
+// generated CA rather than needing --insecure-registry.
+func (d *Daemon) installRegistryCA(host, caPath string) error {
+	dir := filepath.Join(registryCertsDir, host)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return errors.Wrapf(err, "[%s] failed to create certs.d directory for %s", d.id, host)
+	}
+	ca, err := os.ReadFile(caPath)
+	if err != nil {
+		return errors.Wrapf(err, "[%s] failed to read registry CA", d.id)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "ca.crt"), ca, 0o644); err != nil {
+		return errors.Wrapf(err, "[%s] failed to install registry CA for %s", d.id, host)
+	}
+	return nil
+}
+
+// addInsecureRegistry adds host to the daemon's insecure-registries and
+// reloads the daemon's config so it takes effect without a restart.
+func (d *Daemon) addInsecureRegistry(host string) error {
+	return d.editConfig(func(cfg map[string]any) {
+		cfg["insecure-registries"] = appendUnique(cfg["insecure-registries"], host)
+	})
+}
+
+// removeInsecureRegistry undoes addInsecureRegistry.
+func (d *Daemon) removeInsecureRegistry(host string) error {
+	return d.editConfig(func(cfg map[string]any) {
+		cfg["insecure-registries"] = removeString(cfg["insecure-registries"], host)
+	})
+}
+
+// editConfig reads the daemon's config file, applies edit, writes it back,
+// and reloads the running daemon so the change takes effect.
+func (d *Daemon) editConfig(edit func(map[string]any)) error {
+	b, err := os.ReadFile(d.configFilePath)
+	if err != nil {
+		return err
+	}
+	cfg := map[string]any{}
+	if len(b) > 0 {
+		if err := json.Unmarshal(b, &cfg); err != nil {
+			return err
+		}
+	}
+	edit(cfg)
+	b, err = json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(d.configFilePath, b, 0o644); err != nil {
+		return err
+	}
+	if d.cmd == nil {
+		// Daemon isn't running (yet); the file will be picked up on start.
+		return nil
+	}
+	return d.ReloadConfig()
+}
+
+// stringSlice converts a config value holding a string list back into
+// []string. The value may already be a []string (set in-process and never
+// round-tripped through JSON yet), or a []interface{} of strings (the shape
+// json.Unmarshal produces for a JSON array decoded into map[string]any);
+// asserting v.([]string) directly only works in the former case, and
+// silently discards the value once it's been through the config file and
+// read back as the latter.
+func stringSlice(v any) []string {
+	switch vv := v.(type) {
+	case []string:
+		return vv
+	case []interface{}:
+		out := make([]string, 0, len(vv))
+		for _, e := range vv {
+			if s, ok := e.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	default:
+		return nil
+	}
+}
+
+func appendUnique(v any, s string) []string {
+	existing := stringSlice(v)
+	for _, e := range existing {
+		if e == s {
+			return existing
+		}
+	}
+	return append(existing, s)
+}
+
+func removeString(v any, s string) []string {
+	existing := stringSlice(v)
+	out := existing[:0]
+	for _, e := range existing {
+		if e != s {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// Push tags localRef as remoteRef, qualified against this registry, and
+// pushes it.
+func (r *Registry) Push(ctx context.Context, c *client.Client, localRef, remoteRef string) error {
+	qualified := r.host + "/" + remoteRef
+	if err := c.ImageTag(ctx, localRef, qualified); err != nil {
+		return errors.Wrapf(err, "failed to tag %s as %s", localRef, qualified)
+	}
+	rc, err := c.ImagePush(ctx, qualified, image.PushOptions{})
+	if err != nil {
+		return errors.Wrapf(err, "failed to push %s", qualified)
+	}
+	defer rc.Close()
+	_, err = io.Copy(io.Discard, rc)
+	return err
+}
+
+// Pull pulls remoteRef, qualified against this registry, and tags the
+// result as localRef.
+func (r *Registry) Pull(ctx context.Context, c *client.Client, remoteRef, localRef string) error {
+	qualified := r.host + "/" + remoteRef
+	rc, err := c.ImagePull(ctx, qualified, image.PullOptions{})
+	if err != nil {
+		return errors.Wrapf(err, "failed to pull %s", qualified)
+	}
+	defer rc.Close()
+	if _, err := io.Copy(io.Discard, rc); err != nil {
+		return err
+	}
+	return c.ImageTag(ctx, qualified, localRef)
+}
+
+// Tag tags localRef as remoteRef, qualified against this registry, without
+// pushing it.
+func (r *Registry) Tag(ctx context.Context, c *client.Client, localRef, remoteRef string) error {
+	return c.ImageTag(ctx, localRef, r.host+"/"+remoteRef)
+}
+
+// Manifest fetches the raw manifest for ref (qualified against this
+// registry) directly from the registry's v2 HTTP API, using Docker or OCI
+// media types in the Accept header according to the WithRegistryOCIMediaTypes
+// option StartRegistry was given.
+func (r *Registry) Manifest(ctx context.Context, ref string) ([]byte, error) {
+	accept := "application/vnd.docker.distribution.manifest.v2+json"
+	if r.cfg.ociMediaTypes {
+		accept = "application/vnd.oci.image.manifest.v1+json"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.manifestURL(ref), http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", accept)
+	resp, err := r.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("GET %s: unexpected status %s", req.URL, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// DeleteManifest deletes ref (qualified against this registry) from the
+// registry by digest, via the registry's v2 HTTP API.
+func (r *Registry) DeleteManifest(ctx context.Context, ref string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, r.manifestURL(ref), http.NoBody)
+	if err != nil {
+		return err
+	}
+	resp, err := r.httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		return errors.Errorf("DELETE %s: unexpected status %s", req.URL, resp.Status)
+	}
+	return nil
+}
+
+func (r *Registry) manifestURL(ref string) string {
+	repo, tagOrDigest := splitRef(ref)
+	scheme := "http"
+	if r.cfg.tls {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s/v2/%s/manifests/%s", scheme, r.host, repo, tagOrDigest)
+}
+
+func (r *Registry) httpClient() *http.Client {
+	c := &http.Client{}
+	if r.cfg.tls {
+		c.Transport = &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}} //nolint:gosec // fixture-generated throwaway cert
+	}
+	if r.cfg.username != "" {
+		c.Transport = &basicAuthRoundTripper{
+			username: r.cfg.username,
+			password: r.cfg.password,
+			base:     cmpTransport(c.Transport),
+		}
+	}
+	return c
+}
+
+func cmpTransport(t http.RoundTripper) http.RoundTripper {
+	if t != nil {
+		return t
+	}
+	return http.DefaultTransport
+}
+
+type basicAuthRoundTripper struct {
+	username, password string
+	base               http.RoundTripper
+}
+
+func (t *basicAuthRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	req.SetBasicAuth(t.username, t.password)
+	return t.base.RoundTrip(req)
+}
+
+func splitRef(ref string) (repo, tagOrDigest string) {
+	if i := lastIndexAny(ref, "@"); i >= 0 {
+		return ref[:i], ref[i+1:]
+	}
+	if i := lastIndexAny(ref, ":"); i >= 0 {
+		return ref[:i], ref[i+1:]
+	}
+	return ref, "latest"
+}
+
+func lastIndexAny(s, chars string) int {
+	for i := len(s) - 1; i >= 0; i-- {
+		for _, c := range chars {
+			if rune(s[i]) == c {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// writeHtpasswd writes a single-entry htpasswd file for username/password,
+// using bcrypt as the registry's htpasswd auth backend requires.
+func writeHtpasswd(path, username, password string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(fmt.Sprintf("%s:%s\n", username, hash)), 0o644)
+}
+
+// generateRegistryCert writes a single self-signed certificate, which also
+// serves as its own CA, as registry-cert.pem with its key as
+// registry-key.pem into dir, for use with WithRegistryTLS.
+func generateRegistryCert(dir string) error {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "docker-test-registry"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		IsCA:         true,
+		KeyUsage:     x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+
+	certOut, err := os.Create(filepath.Join(dir, "registry-cert.pem"))
+	if err != nil {
+		return err
+	}
+	defer certOut.Close()
+	if err := pem.Encode(certOut, &pem.Block{Type: "CERTIFICATE", Bytes: der}); err != nil {
+		return err
+	}
+
+	keyOut, err := os.OpenFile(filepath.Join(dir, "registry-key.pem"), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	defer keyOut.Close()
+	return pem.Encode(keyOut, &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+}